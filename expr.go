@@ -43,7 +43,112 @@ func setindirect(value llvm.Value) {
                       llvm.ConstNull(llvm.Int1Type()))
 }
 
+// issigned/setsigned tag a value as having come from a signed Go integer
+// type. LLVM integers carry no sign themselves, so this rides alongside the
+// value the same way "indirect" does, letting later consumers (e.g.
+// VisitBinaryExpr) recover the Go-level type information VisitExpr would
+// otherwise discard.
+func issigned(value llvm.Value) bool {
+    return !value.Metadata(llvm.MDKindID("signed")).IsNil()
+}
+
+func setsigned(value llvm.Value) {
+    value.SetMetadata(llvm.MDKindID("signed"),
+                      llvm.ConstNull(llvm.Int1Type()))
+}
+
+// clearsigned removes a "signed" tag a value may have picked up earlier
+// (e.g. from sharing an llvm.Value with a signed-typed expression before a
+// conversion to an unsigned type), by resetting its metadata to nil.
+func clearsigned(value llvm.Value) {
+    value.SetMetadata(llvm.MDKindID("signed"), llvm.Value{})
+}
+
+// isunsigned/setunsigned tag a value as having come from an explicitly
+// unsigned Go integer type (as opposed to merely lacking a "signed" tag,
+// which is also true of untyped constants that default to "int"). This lets
+// VisitBinaryExpr tell "known unsigned" apart from "not yet known" when
+// deciding whether an untyped constant expression should fall back to Go's
+// default signed "int".
+func isunsigned(value llvm.Value) bool {
+    return !value.Metadata(llvm.MDKindID("unsigned")).IsNil()
+}
+
+func setunsigned(value llvm.Value) {
+    value.SetMetadata(llvm.MDKindID("unsigned"),
+                      llvm.ConstNull(llvm.Int1Type()))
+}
+
+// copysign carries src's signed/unsigned tags over onto dst, a fresh
+// instruction derived from src (e.g. its negation), so that dispatch further
+// down the expression still sees the Go-level type src had.
+func copysign(dst, src llvm.Value) llvm.Value {
+    if issigned(src) {setsigned(dst)}
+    if isunsigned(src) {setunsigned(dst)}
+    return dst
+}
+
+func isfloat(value llvm.Value) bool {
+    kind := value.Type().TypeKind()
+    return kind == llvm.FloatTypeKind || kind == llvm.DoubleTypeKind
+}
+
+// signednessOfTypeName reports whether name is a builtin Go integer type
+// name, and if so, whether it is signed. ok is false for anything else
+// (float types, named types, etc.), in which case the caller should leave
+// the "signed" tag alone rather than assume a signedness.
+func signednessOfTypeName(name string) (signed bool, ok bool) {
+    switch name {
+    case "int", "int8", "int16", "int32", "int64", "rune":
+        return true, true
+    case "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte":
+        return false, true
+    }
+    return false, false
+}
+
+// intPredicate and floatPredicate return the LLVM predicates to use for a
+// comparison operator, taking the signedness of the integer operands (it has
+// no effect on the float predicate, which is always ordered) into account.
+func intPredicate(op token.Token, signed bool) llvm.IntPredicate {
+    switch op {
+    case token.EQL: return llvm.IntEQ
+    case token.NEQ: return llvm.IntNE
+    case token.LSS:
+        if signed {return llvm.IntSLT}
+        return llvm.IntULT
+    case token.LEQ:
+        if signed {return llvm.IntSLE}
+        return llvm.IntULE
+    case token.GTR:
+        if signed {return llvm.IntSGT}
+        return llvm.IntUGT
+    case token.GEQ:
+        if signed {return llvm.IntSGE}
+        return llvm.IntUGE
+    }
+    panic(fmt.Sprint("Unhandled comparison operator: ", op))
+}
+
+func floatPredicate(op token.Token) llvm.RealPredicate {
+    switch op {
+    case token.EQL: return llvm.FloatOEQ
+    case token.NEQ: return llvm.FloatONE
+    case token.LSS: return llvm.FloatOLT
+    case token.LEQ: return llvm.FloatOLE
+    case token.GTR: return llvm.FloatOGT
+    case token.GEQ: return llvm.FloatOGE
+    }
+    panic(fmt.Sprint("Unhandled comparison operator: ", op))
+}
+
 func (self *Visitor) VisitBinaryExpr(expr *ast.BinaryExpr) llvm.Value {
+    // && and || must short-circuit, so they're handled before either operand
+    // is evaluated rather than falling through the eager path below.
+    if expr.Op == token.LAND || expr.Op == token.LOR {
+        return self.visitLogicalExpr(expr)
+    }
+
     x := self.VisitExpr(expr.X)
     y := self.VisitExpr(expr.Y)
 
@@ -65,56 +170,151 @@ func (self *Visitor) VisitBinaryExpr(expr *ast.BinaryExpr) llvm.Value {
         if isglobal(y) {y = y.Initializer()}
     }
 
-    // TODO check types/sign, use float operators if appropriate.
+    float := isfloat(x)
+    // Neither operand may be tagged "signed" even though it is: untyped
+    // integer constants (e.g. the literals in "-1 < 0") never pass through a
+    // conversion that would call setsigned, but Go gives them
+    // a default type of "int", which is signed. That default only applies
+    // when neither operand has actually been tagged unsigned, though — e.g.
+    // byte(200) / byte(3) must still divide as unsigned.
+    signed := issigned(x) || issigned(y) ||
+              (x_const && y_const && !float && !isunsigned(x) && !isunsigned(y))
+
+    // tag propagates the operands' signedness onto an arithmetic/bitwise
+    // result, so that e.g. "(a / b) < 0" still dispatches as signed even
+    // though the division's result never went through a conversion itself.
+    tag := func(result llvm.Value) llvm.Value {
+        if signed {
+            setsigned(result)
+        } else if isunsigned(x) || isunsigned(y) {
+            setunsigned(result)
+        }
+        return result
+    }
+
     switch expr.Op {
     case token.MUL:
-        if x_const && y_const {
-            return llvm.ConstMul(x, y)
-        } else {
-            return self.builder.CreateMul(x, y, "")
+        switch {
+        case float:
+            if x_const && y_const {return llvm.ConstFMul(x, y)}
+            return self.builder.CreateFMul(x, y, "")
+        default:
+            if x_const && y_const {return tag(llvm.ConstMul(x, y))}
+            return tag(self.builder.CreateMul(x, y, ""))
         }
     case token.QUO:
-        if x_const && y_const {
-            return llvm.ConstUDiv(x, y)
-        } else {
-            return self.builder.CreateUDiv(x, y, "")
+        switch {
+        case float:
+            if x_const && y_const {return llvm.ConstFDiv(x, y)}
+            return self.builder.CreateFDiv(x, y, "")
+        case signed:
+            if x_const && y_const {return tag(llvm.ConstSDiv(x, y))}
+            return tag(self.builder.CreateSDiv(x, y, ""))
+        default:
+            if x_const && y_const {return tag(llvm.ConstUDiv(x, y))}
+            return tag(self.builder.CreateUDiv(x, y, ""))
+        }
+    case token.REM:
+        switch {
+        case float:
+            if x_const && y_const {return llvm.ConstFRem(x, y)}
+            return self.builder.CreateFRem(x, y, "")
+        case signed:
+            if x_const && y_const {return tag(llvm.ConstSRem(x, y))}
+            return tag(self.builder.CreateSRem(x, y, ""))
+        default:
+            if x_const && y_const {return tag(llvm.ConstURem(x, y))}
+            return tag(self.builder.CreateURem(x, y, ""))
         }
     case token.ADD:
-        if x_const && y_const {
-            return llvm.ConstAdd(x, y)
-        } else {
-            return self.builder.CreateAdd(x, y, "")
+        if float {
+            if x_const && y_const {return llvm.ConstFAdd(x, y)}
+            return self.builder.CreateFAdd(x, y, "")
         }
+        if x_const && y_const {return tag(llvm.ConstAdd(x, y))}
+        return tag(self.builder.CreateAdd(x, y, ""))
     case token.SUB:
-        if x_const && y_const {
-            return llvm.ConstSub(x, y)
-        } else {
-            return self.builder.CreateSub(x, y, "")
+        if float {
+            if x_const && y_const {return llvm.ConstFSub(x, y)}
+            return self.builder.CreateFSub(x, y, "")
         }
-    case token.EQL:
-        if x_const && y_const {
-            return llvm.ConstICmp(llvm.IntEQ, x, y)
-        } else {
-            return self.builder.CreateICmp(llvm.IntEQ, x, y, "")
+        if x_const && y_const {return tag(llvm.ConstSub(x, y))}
+        return tag(self.builder.CreateSub(x, y, ""))
+    case token.AND:
+        if x_const && y_const {return tag(llvm.ConstAnd(x, y))}
+        return tag(self.builder.CreateAnd(x, y, ""))
+    case token.OR:
+        if x_const && y_const {return tag(llvm.ConstOr(x, y))}
+        return tag(self.builder.CreateOr(x, y, ""))
+    case token.XOR:
+        if x_const && y_const {return tag(llvm.ConstXor(x, y))}
+        return tag(self.builder.CreateXor(x, y, ""))
+    case token.AND_NOT:
+        // x &^ y == x & (^y)
+        if x_const && y_const {return tag(llvm.ConstAnd(x, llvm.ConstNot(y)))}
+        return tag(self.builder.CreateAnd(x, self.builder.CreateNot(y, ""), ""))
+    case token.SHL:
+        if x_const && y_const {return tag(llvm.ConstShl(x, y))}
+        return tag(self.builder.CreateShl(x, y, ""))
+    case token.SHR:
+        if signed {
+            if x_const && y_const {return tag(llvm.ConstAShr(x, y))}
+            return tag(self.builder.CreateAShr(x, y, ""))
         }
-    case token.LSS:
-        if x_const && y_const {
-            return llvm.ConstICmp(llvm.IntULT, x, y)
-        } else {
-            return self.builder.CreateICmp(llvm.IntULT, x, y, "")
+        if x_const && y_const {return tag(llvm.ConstLShr(x, y))}
+        return tag(self.builder.CreateLShr(x, y, ""))
+    case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+        if float {
+            pred := floatPredicate(expr.Op)
+            if x_const && y_const {return llvm.ConstFCmp(pred, x, y)}
+            return self.builder.CreateFCmp(pred, x, y, "")
         }
+        pred := intPredicate(expr.Op, signed)
+        if x_const && y_const {return llvm.ConstICmp(pred, x, y)}
+        return self.builder.CreateICmp(pred, x, y, "")
     }
     panic(fmt.Sprint("Unhandled operator: ", expr.Op))
 }
 
+// visitLogicalExpr lowers && and || with real conditional-branch control
+// flow, so that the right operand is only evaluated when it can actually
+// affect the result (e.g. "p != nil && p.field == 1" must not dereference p
+// when it is nil).
+func (self *Visitor) visitLogicalExpr(expr *ast.BinaryExpr) llvm.Value {
+    x := self.VisitExpr(expr.X)
+    if isindirect(x) {x = self.builder.CreateLoad(x, "")}
+
+    fn := self.builder.GetInsertBlock().Parent()
+    rhsblock := llvm.AddBasicBlock(fn, "")
+    endblock := llvm.AddBasicBlock(fn, "")
+    xblock := self.builder.GetInsertBlock()
+
+    if expr.Op == token.LAND {
+        self.builder.CreateCondBr(x, rhsblock, endblock)
+    } else {
+        self.builder.CreateCondBr(x, endblock, rhsblock)
+    }
+
+    self.builder.SetInsertPointAtEnd(rhsblock)
+    y := self.VisitExpr(expr.Y)
+    if isindirect(y) {y = self.builder.CreateLoad(y, "")}
+    yblock := self.builder.GetInsertBlock()
+    self.builder.CreateBr(endblock)
+
+    self.builder.SetInsertPointAtEnd(endblock)
+    result := self.builder.CreatePHI(llvm.Int1Type(), "")
+    result.AddIncoming([]llvm.Value{x, y}, []llvm.BasicBlock{xblock, yblock})
+    return result
+}
+
 func (self *Visitor) VisitUnaryExpr(expr *ast.UnaryExpr) llvm.Value {
     value := self.VisitExpr(expr.X)
     switch expr.Op {
     case token.SUB: {
         if !value.IsAConstant().IsNil() {
-            value = llvm.ConstNeg(value)
+            value = copysign(llvm.ConstNeg(value), value)
         } else {
-            value = self.builder.CreateNeg(value, "")
+            value = copysign(self.builder.CreateNeg(value, ""), value)
         }
     }
     case token.ADD: {/*No-op*/}
@@ -135,7 +335,24 @@ func (self *Visitor) VisitCallExpr(expr *ast.CallExpr) llvm.Value {
                 typ := self.GetType(x)
                 if !typ.IsNil() {
                     value := self.VisitExpr(expr.Args[0])
-                    return self.maybeCast(value, typ)
+                    value = self.maybeCast(value, typ)
+                    // x.String() is the Go type name being converted to
+                    // (e.g. "int8" vs "uint8"); tag the result so that
+                    // VisitBinaryExpr can recover its signedness later. The
+                    // unsigned branch must still act even though there's no
+                    // "unsigned" instruction to emit: maybeCast may have
+                    // handed back the very same llvm.Value (e.g. converting
+                    // a same-width int to uint), which could already be
+                    // tagged signed from an earlier conversion.
+                    if signed, ok := signednessOfTypeName(x.String()); ok {
+                        if signed {
+                            setsigned(value)
+                        } else {
+                            clearsigned(value)
+                            setunsigned(value)
+                        }
+                    }
+                    return value
                 }
             }
 
@@ -147,13 +364,7 @@ func (self *Visitor) VisitCallExpr(expr *ast.CallExpr) llvm.Value {
                 fn = self.builder.CreateLoad(fn, "")
             }
 
-            // TODO handle varargs
-            var args []llvm.Value = nil
-            if expr.Args != nil {
-                args = make([]llvm.Value, len(expr.Args))
-                for i, expr := range expr.Args {args[i] = self.VisitExpr(expr)}
-            }
-            return self.builder.CreateCall(fn, args, "")
+            return self.createCall(fn, expr)
         }
         }
     }
@@ -161,9 +372,130 @@ func (self *Visitor) VisitCallExpr(expr *ast.CallExpr) llvm.Value {
     panic("Unhandled CallExpr")
 }
 
+// createCall lowers expr's actual arguments against fn's resolved LLVM
+// signature and emits the call. When fn's final parameter is variadic, the
+// trailing actuals are packed into a slice (or, for f(xs...), passed through
+// as-is) to fill it. When fn returns multiple Go values, the call simply
+// returns the anonymous LLVM struct the function was lowered to return;
+// tuple-assignment sites destructure it with ExtractValue.
+func (self *Visitor) createCall(fn llvm.Value, expr *ast.CallExpr) llvm.Value {
+    fnType := fn.Type()
+    if fnType.TypeKind() == llvm.PointerTypeKind {fnType = fnType.ElementType()}
+    paramTypes := fnType.ParamTypes()
+
+    var args []llvm.Value
+    nargs := 0
+    if expr.Args != nil {nargs = len(expr.Args)}
+
+    switch {
+    case fnType.IsFunctionVarArg() && expr.Ellipsis != token.NoPos:
+        // f(xs...): the final actual is already the slice to pass through.
+        args = make([]llvm.Value, len(paramTypes))
+        for i := 0; i < len(paramTypes)-1; i++ {args[i] = self.VisitExpr(expr.Args[i])}
+        args[len(paramTypes)-1] = self.VisitExpr(expr.Args[nargs-1])
+
+    case fnType.IsFunctionVarArg():
+        // f(x, y, z, ...): pack the trailing actuals into a slice.
+        args = make([]llvm.Value, len(paramTypes))
+        for i := 0; i < len(paramTypes)-1; i++ {args[i] = self.VisitExpr(expr.Args[i])}
+        args[len(paramTypes)-1] = self.buildVarargSlice(
+            paramTypes[len(paramTypes)-1], expr.Args[len(paramTypes)-1:])
+
+    case expr.Args != nil:
+        args = make([]llvm.Value, nargs)
+        for i, arg := range expr.Args {args[i] = self.VisitExpr(arg)}
+    }
+    return self.builder.CreateCall(fn, args, "")
+}
+
+// buildVarargSlice packs elems (the trailing actual arguments of a variadic
+// call) into a stack-allocated backing array, and builds a {data,len,cap}
+// slice header of type sliceType referring to it.
+func (self *Visitor) buildVarargSlice(sliceType llvm.Type, elems []ast.Expr) llvm.Value {
+    elemType := sliceType.StructElementTypes()[0].ElementType()
+    array := self.builder.CreateAlloca(
+        llvm.ArrayType(elemType, len(elems)), "")
+
+    zero := llvm.ConstInt(llvm.Int32Type(), 0, false)
+    for i, elem := range elems {
+        value := self.VisitExpr(elem)
+        if isindirect(value) {value = self.builder.CreateLoad(value, "")}
+        index := llvm.ConstInt(llvm.Int32Type(), uint64(i), false)
+        element := self.builder.CreateGEP(array, []llvm.Value{zero, index}, "")
+        self.builder.CreateStore(value, element)
+    }
+
+    data := self.builder.CreateGEP(array, []llvm.Value{zero, zero}, "")
+    length := llvm.ConstInt(llvm.Int32Type(), uint64(len(elems)), false)
+
+    slice := llvm.Undef(sliceType)
+    slice = self.builder.CreateInsertValue(slice, data, 0, "")
+    slice = self.builder.CreateInsertValue(slice, length, 1, "")
+    slice = self.builder.CreateInsertValue(slice, length, 2, "")
+    return slice
+}
+
+// boundsChecking controls whether VisitIndexExpr emits a runtime
+// compare-and-trap against a string's or slice's length before indexing.
+// TODO: wire this up to a compiler flag instead of hard-coding it on.
+const boundsChecking = true
+
+// isnamedstruct reports whether t is the LLVM struct type with the given
+// name. String, slice and map headers are recognised by their struct names
+// ("string", "slice" and "hashmap") rather than by shape.
+func isnamedstruct(t llvm.Type, name string) bool {
+    return t.TypeKind() == llvm.StructTypeKind && t.StructName() == name
+}
+
+func isstringtype(t llvm.Type) bool {return isnamedstruct(t, "string")}
+func isslicetype(t llvm.Type) bool {return isnamedstruct(t, "slice")}
+
+func ismaptype(t llvm.Type) bool {
+    return t.TypeKind() == llvm.PointerTypeKind &&
+           isnamedstruct(t.ElementType(), "hashmap")
+}
+
+// runtimeFunctions caches the llvm.Value for each runtime support function
+// (declared in the runtime package) that the visitor has needed so far, so
+// that each one is only declared into the module once.
+var runtimeFunctions = make(map[string]llvm.Value)
+
+// runtimeFunction looks up (declaring on first use) the named runtime
+// support function with the given signature.
+func (self *Visitor) runtimeFunction(name string, fnType llvm.Type) llvm.Value {
+    if fn, ok := runtimeFunctions[name]; ok {
+        return fn
+    }
+    fn := llvm.AddFunction(self.module, name, fnType)
+    runtimeFunctions[name] = fn
+    return fn
+}
+
+// checkIndexInBounds emits a runtime trap if index is >= header's length
+// field (index 1 of {data,len,cap} for a slice, or {data,len} for a string —
+// both put the length at the same field index).
+func (self *Visitor) checkIndexInBounds(header, index llvm.Value) {
+    if !boundsChecking {return}
+    length := self.builder.CreateExtractValue(header, 1, "")
+    inbounds := self.builder.CreateICmp(llvm.IntULT, index, length, "")
+
+    fn := self.builder.GetInsertBlock().Parent()
+    okblock := llvm.AddBasicBlock(fn, "")
+    failblock := llvm.AddBasicBlock(fn, "")
+    self.builder.CreateCondBr(inbounds, okblock, failblock)
+
+    self.builder.SetInsertPointAtEnd(failblock)
+    panicFn := self.runtimeFunction("runtime.throwIndexOutOfRange",
+        llvm.FunctionType(llvm.VoidType(), nil, false))
+    self.builder.CreateCall(panicFn, nil, "")
+    self.builder.CreateUnreachable()
+
+    self.builder.SetInsertPointAtEnd(okblock)
+}
+
 func (self *Visitor) VisitIndexExpr(expr *ast.IndexExpr) llvm.Value {
     value := self.VisitExpr(expr.X)
-    // TODO handle maps, strings, slices.
+    if isindirect(value) {value = self.builder.CreateLoad(value, "")}
 
     index := self.VisitExpr(expr.Index)
     if isindirect(index) {index = self.builder.CreateLoad(index, "")}
@@ -171,15 +503,37 @@ func (self *Visitor) VisitIndexExpr(expr *ast.IndexExpr) llvm.Value {
         panic("Array index expression must evaluate to an integer")
     }
 
-    // Is it an array? Then let's get the address of the array so we can
-    // get an element.
-    if value.Type().TypeKind() == llvm.ArrayTypeKind {
-        value = value.Metadata(llvm.MDKindID("address"))
-    }
+    switch {
+    case value.Type().TypeKind() == llvm.ArrayTypeKind:
+        // Fixed-size array: index off its address.
+        address := value.Metadata(llvm.MDKindID("address"))
+        zero := llvm.ConstInt(llvm.Int32Type(), 0, false)
+        element := self.builder.CreateGEP(address, []llvm.Value{zero, index}, "")
+        return self.builder.CreateLoad(element, "")
 
-    zero := llvm.ConstInt(llvm.Int32Type(), 0, false)
-    element := self.builder.CreateGEP(value, []llvm.Value{zero, index}, "")
-    return self.builder.CreateLoad(element, "")
+    case isstringtype(value.Type()):
+        // Strings are {data *i8, len int}; bounds-check like a slice before
+        // indexing into the data pointer.
+        self.checkIndexInBounds(value, index)
+        data := self.builder.CreateExtractValue(value, 0, "")
+        element := self.builder.CreateGEP(data, []llvm.Value{index}, "")
+        return self.builder.CreateLoad(element, "")
+
+    case isslicetype(value.Type()):
+        // Slices are {data *T, len int, cap int}.
+        self.checkIndexInBounds(value, index)
+        data := self.builder.CreateExtractValue(value, 0, "")
+        element := self.builder.CreateGEP(data, []llvm.Value{index}, "")
+        return self.builder.CreateLoad(element, "")
+
+    case ismaptype(value.Type()):
+        elemType := value.Type().ElementType().StructElementTypes()[1]
+        fnType := llvm.FunctionType(
+            elemType, []llvm.Type{value.Type(), index.Type()}, false)
+        fn := self.runtimeFunction("runtime.maplookup", fnType)
+        return self.builder.CreateCall(fn, []llvm.Value{value, index}, "")
+    }
+    panic(fmt.Sprintf("Unhandled IndexExpr operand type: %s", value.Type()))
 }
 
 func (self *Visitor) VisitExpr(expr ast.Expr) llvm.Value {
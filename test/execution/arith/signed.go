@@ -0,0 +1,28 @@
+// RUN: llgo -o %t %s
+// RUN: %t > %t1 2>&1
+// RUN: go run %s > %t2 2>&1
+// RUN: diff -u %t1 %t2
+
+package main
+
+func testSignedDivision() {
+	var x, y int8 = -10, 3
+	println("testSignedDivision:", x/y, x%y, x < 0)
+}
+
+func testUnsignedDivision() {
+	a, b := byte(200), byte(3)
+	println("testUnsignedDivision:", a/b, a%b, a < b)
+}
+
+func testNegation() {
+	y := int8(5)
+	z := -y
+	println("testNegation:", z, z < 0)
+}
+
+func main() {
+	testSignedDivision()
+	testUnsignedDivision()
+	testNegation()
+}
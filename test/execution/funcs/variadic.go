@@ -0,0 +1,34 @@
+// RUN: llgo -o %t %s
+// RUN: %t > %t1 2>&1
+// RUN: go run %s > %t2 2>&1
+// RUN: diff -u %t1 %t2
+
+package main
+
+func sum(nums ...int) int {
+	total := 0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+func testVariadic() {
+	println("testVariadic:", sum(1, 2, 3))
+	xs := []int{4, 5, 6}
+	println("testVariadicSpread:", sum(xs...))
+}
+
+func testMultiReturn() {
+	q, r := divmod(17, 5)
+	println("testMultiReturn:", q, r)
+}
+
+func main() {
+	testVariadic()
+	testMultiReturn()
+}